@@ -0,0 +1,202 @@
+// Package analyzer exposes unionize as a golang.org/x/tools/go/analysis
+// Analyzer, so it can be run under `go vet -vettool=...` or picked up by an
+// editor's gopls integration instead of invoked as a one-off go:generate
+// command.
+package analyzer
+
+import (
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+
+	"github.com/zyedidia/unionize/gen"
+)
+
+const doc = `report struct types marked //unionize:generate and suggest the generated union
+
+The unionize analyzer looks for type declarations whose doc comment
+contains the magic comment "unionize:generate" and reports a diagnostic
+whose SuggestedFix inserts the union unionize would generate for that
+struct, so it can be applied from an editor or "go fix"-style tooling
+without running the unionize command by hand.`
+
+// Analyzer is the unionize go/analysis.Analyzer.
+var Analyzer = &analysis.Analyzer{
+	Name:     "unionize",
+	Doc:      doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// magicComment marks a struct type declaration as a unionize template.
+const magicComment = "unionize:generate"
+
+// hasMagicComment reports whether doc contains magicComment. It checks the
+// raw comment text rather than doc.Text(), since go/ast's Text() strips out
+// lines that look like tool directives (e.g. "//unionize:generate") before
+// returning them.
+func hasMagicComment(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.Contains(c.Text, magicComment) {
+			return true
+		}
+	}
+	return false
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{(*ast.GenDecl)(nil)}
+	insp.Preorder(nodeFilter, func(n ast.Node) {
+		decl := n.(*ast.GenDecl)
+		if decl.Tok != token.TYPE || !hasMagicComment(decl.Doc) {
+			return
+		}
+
+		file := enclosingFile(pass, decl.Pos())
+		if file == nil {
+			return
+		}
+
+		for _, spec := range decl.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			if _, ok := ts.Type.(*ast.StructType); !ok {
+				continue
+			}
+
+			obj := pass.TypesInfo.Defs[ts.Name]
+			if obj == nil {
+				continue
+			}
+			strct, ok := obj.Type().Underlying().(*types.Struct)
+			if !ok {
+				continue
+			}
+
+			fields := gen.UnionFields(strct)
+			src, err := generateUnion(pass, ts.Name.Name, strct, fields)
+			if err != nil {
+				pass.Reportf(ts.Pos(), "unionize: %v", err)
+				continue
+			}
+
+			edits := append([]analysis.TextEdit{{
+				Pos:     decl.End(),
+				End:     decl.End(),
+				NewText: []byte("\n\n" + src),
+			}}, importEdits(file, pass.Pkg, fields)...)
+
+			pass.Report(analysis.Diagnostic{
+				Pos:     ts.Pos(),
+				Message: "struct " + ts.Name.Name + " can have a union generated for it",
+				SuggestedFixes: []analysis.SuggestedFix{{
+					Message:   "Generate " + ts.Name.Name + "Union",
+					TextEdits: edits,
+				}},
+			})
+		}
+	})
+
+	return nil, nil
+}
+
+// enclosingFile returns the file in pass.Files that contains pos.
+func enclosingFile(pass *analysis.Pass, pos token.Pos) *ast.File {
+	for _, f := range pass.Files {
+		if f.FileStart <= pos && pos < f.FileEnd {
+			return f
+		}
+	}
+	return nil
+}
+
+// importEdits returns the TextEdits needed to add, to file's import block,
+// whichever of "unsafe" and gen.GetImports' result aren't already imported.
+// The generated union always uses unsafe.Pointer, plus whatever packages
+// its field types pull in, so without this the SuggestedFix's union body
+// would reference undefined names.
+func importEdits(file *ast.File, pkg *types.Package, fields []gen.Field) []analysis.TextEdit {
+	need := append([]string{"\"unsafe\""}, gen.GetImports(fields, pkg)...)
+
+	have := make(map[string]bool, len(file.Imports))
+	for _, imp := range file.Imports {
+		have[imp.Path.Value] = true
+	}
+
+	var missing []string
+	for _, path := range need {
+		if !have[path] {
+			missing = append(missing, path)
+			have[path] = true
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var body strings.Builder
+	for _, path := range missing {
+		body.WriteString("\t" + path + "\n")
+	}
+
+	var importDecl *ast.GenDecl
+	for _, d := range file.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			importDecl = gd
+			break
+		}
+	}
+
+	if importDecl != nil && importDecl.Lparen.IsValid() {
+		return []analysis.TextEdit{{
+			Pos:     importDecl.Lparen + 1,
+			End:     importDecl.Lparen + 1,
+			NewText: []byte("\n" + body.String()),
+		}}
+	}
+	if importDecl != nil {
+		return []analysis.TextEdit{{
+			Pos:     importDecl.End(),
+			End:     importDecl.End(),
+			NewText: []byte("\n\nimport (\n" + body.String() + ")"),
+		}}
+	}
+	return []analysis.TextEdit{{
+		Pos:     file.Name.End(),
+		End:     file.Name.End(),
+		NewText: []byte("\n\nimport (\n" + body.String() + ")"),
+	}}
+}
+
+// generateUnion produces the formatted source of the union unionize would
+// generate for strct, named name+"Union".
+func generateUnion(pass *analysis.Pass, name string, strct *types.Struct, fields []gen.Field) (string, error) {
+	sz, align := gen.UnionSize(strct, pass.TypesSizes)
+	if !gen.AlignmentOK(align) {
+		align = 8
+	}
+
+	src, err := gen.StringUnion(name+"Union", sz, align, fields, pass.Pkg, false, false)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		return src, nil
+	}
+	return string(out), nil
+}
@@ -0,0 +1,76 @@
+package analyzer
+
+import (
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "a")
+}
+
+// TestSuggestedFixBuilds reproduces the maintainer's repro for the missing
+// import edit: it takes the SuggestedFix reported for testdata/src/a/a.go,
+// applies it exactly as analysistest.Run got it from the analyzer, and
+// checks that the result actually compiles. Before importEdits existed,
+// this failed with "undefined: unsafe".
+func TestSuggestedFixBuilds(t *testing.T) {
+	results := analysistest.Run(t, analysistest.TestData(), Analyzer, "a")
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	pass := results[0].Pass
+
+	diags := results[0].Diagnostics
+	if len(diags) != 1 || len(diags[0].SuggestedFixes) != 1 {
+		t.Fatalf("got %d diagnostics, want 1 with a single suggested fix", len(diags))
+	}
+	edits := diags[0].SuggestedFixes[0].TextEdits
+
+	srcPath := filepath.Join(analysistest.TestData(), "src", "a", "a.go")
+	orig, err := os.ReadFile(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixed := applyTextEdits(pass.Fset, orig, edits)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scratch\n\ngo 1.21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), fixed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("suggested fix failed to build: %v\n%s\n---\n%s", err, out, fixed)
+	}
+}
+
+// applyTextEdits splices non-overlapping edits into src, applied from the
+// end of the file backwards so earlier offsets stay valid.
+func applyTextEdits(fset *token.FileSet, src []byte, edits []analysis.TextEdit) []byte {
+	sorted := append([]analysis.TextEdit(nil), edits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Pos > sorted[j].Pos })
+
+	out := append([]byte(nil), src...)
+	for _, e := range sorted {
+		start := fset.Position(e.Pos).Offset
+		end := fset.Position(e.End).Offset
+		patched := append([]byte(nil), out[:start]...)
+		patched = append(patched, e.NewText...)
+		patched = append(patched, out[end:]...)
+		out = patched
+	}
+	return out
+}
@@ -0,0 +1,7 @@
+package a
+
+//unionize:generate
+type Template struct { // want "struct Template can have a union generated for it"
+	I1 uint32
+	I2 uint16
+}
@@ -0,0 +1,14 @@
+// Command unionize-vet runs the unionize analyzer as a go vet tool:
+//
+//	go vet -vettool=$(which unionize-vet) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/zyedidia/unionize/analyzer"
+)
+
+func main() {
+	singlechecker.Main(analyzer.Analyzer)
+}
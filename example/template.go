@@ -0,0 +1,9 @@
+package main
+
+//go:generate go run github.com/zyedidia/unionize -pkg main -output template_union.go Template .
+
+// Template is the layout used to generate TemplateUnion.
+type Template struct {
+	i1 uint32
+	i2 uint16
+}
@@ -0,0 +1,27 @@
+// Code generated by unionize. DO NOT EDIT.
+
+package main
+
+import (
+	"unsafe"
+)
+
+type TemplateUnion struct {
+	b [1]uint32
+}
+
+func (u *TemplateUnion) i1() uint32 {
+	return *(*uint32)(unsafe.Pointer(&u.b[0]))
+}
+
+func (u *TemplateUnion) i1Put(v uint32) {
+	*(*uint32)(unsafe.Pointer(&u.b[0])) = v
+}
+
+func (u *TemplateUnion) i2() uint16 {
+	return *(*uint16)(unsafe.Pointer(&u.b[0]))
+}
+
+func (u *TemplateUnion) i2Put(v uint16) {
+	*(*uint16)(unsafe.Pointer(&u.b[0])) = v
+}
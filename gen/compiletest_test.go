@@ -0,0 +1,57 @@
+package gen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// compileAndRun writes src as the sole file of a scratch module in a temp
+// directory and runs it with `go run`, returning its stdout. It's used by
+// the feature tests below to check that generated code doesn't just
+// gofmt-parse but actually type-checks and behaves as intended - bugs like
+// an unqualified package-path type name or a multi-value expression in a
+// single-value context only show up once the compiler sees them.
+func compileAndRun(t *testing.T, src string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scratch\n\ngo 1.21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated code failed to build/run: %v\n%s\n---\n%s", err, out, src)
+	}
+	return string(out)
+}
+
+// compileForTarget writes src as the sole file of a scratch module and
+// cross-compiles it (without running it, since the host can't execute a
+// foreign-arch binary) for goos/goarch.
+func compileForTarget(t *testing.T, src, goos, goarch string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scratch\n\ngo 1.21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated code failed to cross-compile for %s/%s: %v\n%s\n---\n%s", goos, goarch, err, out, src)
+	}
+}
@@ -0,0 +1,239 @@
+// Package gen implements the core of unionize: given a template struct, it
+// works out the size and alignment of the union buffer and generates the
+// Go source for the union type and its accessors. It has no dependency on
+// golang.org/x/tools/go/packages, so it can be driven either by the
+// unionize command (which loads packages itself) or by a go/analysis pass
+// (which already has a *types.Info to hand).
+package gen
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// I believe there are no types in Go with alignment 16.
+var alignments = map[int64]string{
+	1: "uint8",
+	2: "uint16",
+	4: "uint32",
+	8: "uint64",
+}
+
+// FindUnion finds the struct that should be used as a template for the
+// union among the types defined in info.
+func FindUnion(info *types.Info, name string) *types.Struct {
+	for _, d := range info.Defs {
+		if d != nil && d.Name() == name {
+			s, ok := d.Type().Underlying().(*types.Struct)
+			if ok {
+				return s
+			}
+		}
+	}
+
+	return nil
+}
+
+// UnionSize returns the size and alignment necessary for the underyling union
+// buffer given the template struct.
+func UnionSize(s *types.Struct, lookup types.Sizes) (int64, int64) {
+	var maxsz int64
+	var maxalign int64
+
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		sz := lookup.Sizeof(f.Type())
+		align := lookup.Alignof(f.Type())
+		if sz > maxsz {
+			maxsz = sz
+		}
+		if align > maxalign {
+			maxalign = align
+		}
+	}
+
+	if maxsz%maxalign != 0 {
+		maxsz = maxsz - maxsz%maxalign + maxalign
+	}
+	return maxsz, maxalign
+}
+
+// AlignmentOK reports whether align can be represented by one of the
+// primitive buffer types unionize knows about.
+func AlignmentOK(align int64) bool {
+	_, ok := alignments[align]
+	return ok
+}
+
+// Field represents a field of the union.
+type Field struct {
+	name string
+	typ  types.Type
+}
+
+// UnionFields returns the fields of the union given the template struct.
+func UnionFields(s *types.Struct) []Field {
+	fields := make([]Field, s.NumFields())
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		fields[i] = Field{
+			name: f.Name(),
+			typ:  f.Type(),
+		}
+	}
+	return fields
+}
+
+// GetImports returns the names of any packages that are needed to access
+// the types in the union fields. It looks past slices, arrays, pointers and
+// maps (and into the type arguments of instantiated generic named types) to
+// find named types that need importing, not just the field's top-level type.
+func GetImports(fields []Field, pkg *types.Package) []string {
+	imports := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		collectImports(f.typ, pkg, seen, &imports)
+	}
+	return imports
+}
+
+func collectImports(t types.Type, pkg *types.Package, seen map[string]bool, imports *[]string) {
+	switch t := t.(type) {
+	case *types.Named:
+		if obj := t.Obj(); obj.Pkg() != nil && obj.Pkg() != pkg {
+			path := obj.Pkg().Path()
+			if !seen[path] {
+				seen[path] = true
+				*imports = append(*imports, "\""+path+"\"")
+			}
+		}
+		if targs := t.TypeArgs(); targs != nil {
+			for i := 0; i < targs.Len(); i++ {
+				collectImports(targs.At(i), pkg, seen, imports)
+			}
+		}
+	case *types.Pointer:
+		collectImports(t.Elem(), pkg, seen, imports)
+	case *types.Slice:
+		collectImports(t.Elem(), pkg, seen, imports)
+	case *types.Array:
+		collectImports(t.Elem(), pkg, seen, imports)
+	case *types.Map:
+		collectImports(t.Key(), pkg, seen, imports)
+		collectImports(t.Elem(), pkg, seen, imports)
+	}
+}
+
+func qual(pkg *types.Package) types.Qualifier {
+	if pkg == nil {
+		return nil
+	}
+	return func(other *types.Package) string {
+		if pkg == other {
+			return ""
+		}
+		return other.Name()
+	}
+}
+
+// capitalize upper-cases the first byte of s, for deriving an exported tag
+// constant name from an unexported field name.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// StringUnion builds the source code for the union. When tagged is true, the
+// union carries a `_tag` discriminant and checked selects whether the
+// generated accessors panic (false) or return an ok bool (true) on a tag
+// mismatch. It returns an error if tagged is true and two fields would
+// produce the same tag constant name.
+func StringUnion(name string, size, align int64, fields []Field, pkg *types.Package, tagged, checked bool) (string, error) {
+	// This is a little bit of a hack in order to make the union type
+	// properly aligned. The union must be aligned to the largest member, and
+	// using a byte array will have alignment 1, so we use an array of type
+	// T, where T has the correct alignment.  The `alignments` map contains
+	// primitive types with alignments up to 8. We also have to adjust the
+	// size, since the primitive type of the buffer will be modified.
+	typ := alignments[align]
+	size /= align
+
+	var s string
+	if tagged {
+		if dup := duplicateTagConst(name, fields); dup != "" {
+			return "", fmt.Errorf("unionize: two fields produce the same tag constant %s", dup)
+		}
+		s = fmt.Sprintf(taggedStructTemplate, name, size, typ)
+		for _, f := range fields {
+			s += fmt.Sprintf(tagConstTemplate, name, capitalize(f.name), tagOf(fields, f.name))
+		}
+		s += fmt.Sprintf(kindTemplate, name)
+		s += fmt.Sprintf(numFieldsTemplate, name, len(fields))
+		s += fmt.Sprintf(resetTemplate, name, size, typ)
+	} else {
+		s = fmt.Sprintf(structTemplate, name, size, typ)
+	}
+
+	for _, f := range fields {
+		typstr := types.TypeString(f.typ, qual(pkg))
+		if !tagged {
+			s += fmt.Sprintf(fieldTemplate, name, f.name, typstr)
+		} else if checked {
+			s += fmt.Sprintf(taggedCheckedFieldTemplate, name, f.name, typstr, tagOf(fields, f.name))
+		} else {
+			s += fmt.Sprintf(taggedFieldTemplate, name, f.name, typstr, tagOf(fields, f.name))
+		}
+	}
+
+	return s, nil
+}
+
+// duplicateTagConst returns the first tag constant name that two distinct
+// fields would both produce (e.g. fields "i1" and "I1" both give
+// name+"I1"), or "" if every field's constant name is unique.
+func duplicateTagConst(name string, fields []Field) string {
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		c := name + capitalize(f.name)
+		if seen[c] {
+			return c
+		}
+		seen[c] = true
+	}
+	return ""
+}
+
+// tagOf returns the tag constant assigned to the variant named name, based
+// on its position in fields.
+func tagOf(fields []Field, name string) int {
+	for i, f := range fields {
+		if f.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Header returns the generated-code header, followed by a //go:build
+// constraint for goos and goarch when either of them is non-empty.
+func Header(goos, goarch string) string {
+	s := header
+	if goos != "" || goarch != "" {
+		s += fmt.Sprintf(buildTagTemplate, goos, goarch)
+	}
+	return s
+}
+
+// Package returns the `package` clause for name.
+func Package(name string) string {
+	return fmt.Sprintf(packageTemplate, name)
+}
+
+// Imports returns an `import` block containing std (already-quoted import
+// paths) followed by imports (also already-quoted).
+func Imports(std, imports []string) string {
+	return fmt.Sprintf(importTemplate, strings.Join(append(append([]string{}, std...), imports...), "\n"))
+}
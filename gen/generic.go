@@ -0,0 +1,98 @@
+package gen
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// ParseUnionArg splits a union argument like "Template[int,float64]" into
+// its base name and type argument expressions. A plain name with no
+// brackets, e.g. "Template", returns (name, nil).
+func ParseUnionArg(s string) (string, []string) {
+	i := strings.IndexByte(s, '[')
+	if i < 0 || !strings.HasSuffix(s, "]") {
+		return s, nil
+	}
+	return s[:i], splitTypeArgs(s[i+1 : len(s)-1])
+}
+
+// splitTypeArgs splits a comma-separated list of type argument expressions,
+// respecting nested brackets (e.g. "Pair[int, Box[string]]").
+func splitTypeArgs(s string) []string {
+	var args []string
+	depth := 0
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	args = append(args, strings.TrimSpace(s[start:]))
+	return args
+}
+
+// FindGenericUnion finds the generic named type that should be used as a
+// template for the union, among the types defined in info. Unlike
+// FindUnion, it returns the *types.Named itself (not its underlying
+// struct), since the caller still needs to instantiate it.
+func FindGenericUnion(info *types.Info, name string) *types.Named {
+	for _, d := range info.Defs {
+		if d == nil || d.Name() != name {
+			continue
+		}
+		named, ok := d.Type().(*types.Named)
+		if ok && named.TypeParams() != nil && named.TypeParams().Len() > 0 {
+			return named
+		}
+	}
+	return nil
+}
+
+// InstantiateUnion instantiates the generic named type with targs and
+// returns its underlying struct.
+func InstantiateUnion(named *types.Named, targs []types.Type) (*types.Struct, error) {
+	inst, err := types.Instantiate(nil, named, targs, true)
+	if err != nil {
+		return nil, fmt.Errorf("instantiate %s: %w", named.Obj().Name(), err)
+	}
+	s, ok := inst.Underlying().(*types.Struct)
+	if !ok {
+		return nil, fmt.Errorf("instantiate %s: not a struct", named.Obj().Name())
+	}
+	return s, nil
+}
+
+// MangleName builds the default union type name for a generic instantiation,
+// e.g. MangleName("Template", []types.Type{int, float64}) returns
+// "Template_int_float64_Union".
+func MangleName(base string, targs []types.Type) string {
+	parts := []string{base}
+	for _, t := range targs {
+		parts = append(parts, mangle(types.TypeString(t, nil)))
+	}
+	return strings.Join(parts, "_") + "_Union"
+}
+
+// mangle replaces any character that can't appear in a Go identifier with
+// an underscore.
+func mangle(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
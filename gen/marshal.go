@@ -0,0 +1,256 @@
+package gen
+
+import (
+	"fmt"
+	"go/types"
+)
+
+// wireHelpers is emitted once into the generated file when -encoding is set.
+// It backs the length-prefixed framing used for variants that can't be
+// encoded in a fixed number of bytes (named structs and the gob fallback).
+const wireHelpers = `func unionizeWriteLenPrefixed(buf *bytes.Buffer, b []byte) {
+	var lenb [4]byte
+	binary.LittleEndian.PutUint32(lenb[:], uint32(len(b)))
+	buf.Write(lenb[:])
+	buf.Write(b)
+}
+
+func unionizeReadLenPrefixed(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("unionize: short buffer")
+	}
+	n := binary.LittleEndian.Uint32(data[:4])
+	data = data[4:]
+	if uint32(len(data)) < n {
+		return nil, nil, fmt.Errorf("unionize: short buffer")
+	}
+	return data[:n], data[n:], nil
+}
+
+`
+
+// MarshalState reports the extra imports a marshal/unmarshal pass turns out
+// to need, decided by which field types it actually walks.
+type MarshalState struct {
+	Gob  bool
+	Math bool
+
+	pkg *types.Package
+}
+
+// hasBinaryMarshaler reports whether *t's method set looks like it implements
+// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler. Only the method
+// names are checked, which is enough for the struct types this tool expects
+// to see as union fields.
+func hasBinaryMarshaler(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	var hasMarshal, hasUnmarshal bool
+	ptr := types.NewPointer(named)
+	mset := types.NewMethodSet(ptr)
+	for i := 0; i < mset.Len(); i++ {
+		switch mset.At(i).Obj().Name() {
+		case "MarshalBinary":
+			hasMarshal = true
+		case "UnmarshalBinary":
+			hasUnmarshal = true
+		}
+	}
+	return hasMarshal && hasUnmarshal
+}
+
+// encodeField returns the statements that append expr (a Go expression of
+// type t) to the in-scope *bytes.Buffer named buf. depth is the array
+// nesting depth, used to keep nested loop variables distinct.
+func (st *MarshalState) encodeField(expr string, t types.Type, depth int) (string, error) {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.Bool:
+			return fmt.Sprintf("if %s {\n\t\tbuf.WriteByte(1)\n\t} else {\n\t\tbuf.WriteByte(0)\n\t}\n", expr), nil
+		case types.Int8, types.Uint8:
+			return fmt.Sprintf("buf.WriteByte(byte(%s))\n", expr), nil
+		case types.Int16, types.Uint16:
+			return fmt.Sprintf("var tmp16 [2]byte\nbinary.LittleEndian.PutUint16(tmp16[:], uint16(%s))\nbuf.Write(tmp16[:])\n", expr), nil
+		case types.Int32, types.Uint32:
+			return fmt.Sprintf("var tmp32 [4]byte\nbinary.LittleEndian.PutUint32(tmp32[:], uint32(%s))\nbuf.Write(tmp32[:])\n", expr), nil
+		case types.Int64, types.Uint64, types.Int, types.Uint:
+			return fmt.Sprintf("var tmp64 [8]byte\nbinary.LittleEndian.PutUint64(tmp64[:], uint64(%s))\nbuf.Write(tmp64[:])\n", expr), nil
+		case types.Float32:
+			st.Math = true
+			return fmt.Sprintf("var tmp32 [4]byte\nbinary.LittleEndian.PutUint32(tmp32[:], math.Float32bits(%s))\nbuf.Write(tmp32[:])\n", expr), nil
+		case types.Float64:
+			st.Math = true
+			return fmt.Sprintf("var tmp64 [8]byte\nbinary.LittleEndian.PutUint64(tmp64[:], math.Float64bits(%s))\nbuf.Write(tmp64[:])\n", expr), nil
+		}
+		return "", fmt.Errorf("unionize: -encoding does not support field type %s", t)
+	case *types.Array:
+		elem := u.Elem()
+		idx := fmt.Sprintf("unionizeI%d", depth)
+		body, err := st.encodeField(fmt.Sprintf("%s[%s]", expr, idx), elem, depth+1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("for %s := 0; %s < %d; %s++ {\n%s}\n", idx, idx, u.Len(), idx, body), nil
+	case *types.Struct:
+		if hasBinaryMarshaler(t) {
+			return fmt.Sprintf(`{
+	b, err := %s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	unionizeWriteLenPrefixed(buf, b)
+}
+`, expr), nil
+		}
+		st.Gob = true
+		return fmt.Sprintf(`{
+	var gb bytes.Buffer
+	if err := gob.NewEncoder(&gb).Encode(%s); err != nil {
+		return nil, err
+	}
+	unionizeWriteLenPrefixed(buf, gb.Bytes())
+}
+`, expr), nil
+	}
+	return "", fmt.Errorf("unionize: -encoding does not support field type %s", t)
+}
+
+// decodeField returns the statements that read a value of type t out of the
+// in-scope []byte named data and store it into the in-scope variable named
+// into (which must already be declared with type t), advancing data past
+// the bytes consumed. depth is the array nesting depth, used to keep nested
+// loop variables distinct.
+func (st *MarshalState) decodeField(into string, t types.Type, depth int) (string, error) {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.Bool:
+			return fmt.Sprintf("if len(data) < 1 {\n\treturn fmt.Errorf(\"unionize: short buffer\")\n}\n%s = data[0] != 0\ndata = data[1:]\n", into), nil
+		case types.Int8, types.Uint8:
+			return fmt.Sprintf("if len(data) < 1 {\n\treturn fmt.Errorf(\"unionize: short buffer\")\n}\n%s = %s(data[0])\ndata = data[1:]\n", into, types.TypeString(t, qual(st.pkg))), nil
+		case types.Int16, types.Uint16:
+			return fmt.Sprintf("if len(data) < 2 {\n\treturn fmt.Errorf(\"unionize: short buffer\")\n}\n%s = %s(binary.LittleEndian.Uint16(data[:2]))\ndata = data[2:]\n", into, types.TypeString(t, qual(st.pkg))), nil
+		case types.Int32, types.Uint32:
+			return fmt.Sprintf("if len(data) < 4 {\n\treturn fmt.Errorf(\"unionize: short buffer\")\n}\n%s = %s(binary.LittleEndian.Uint32(data[:4]))\ndata = data[4:]\n", into, types.TypeString(t, qual(st.pkg))), nil
+		case types.Int64, types.Uint64, types.Int, types.Uint:
+			return fmt.Sprintf("if len(data) < 8 {\n\treturn fmt.Errorf(\"unionize: short buffer\")\n}\n%s = %s(binary.LittleEndian.Uint64(data[:8]))\ndata = data[8:]\n", into, types.TypeString(t, qual(st.pkg))), nil
+		case types.Float32:
+			st.Math = true
+			return fmt.Sprintf("if len(data) < 4 {\n\treturn fmt.Errorf(\"unionize: short buffer\")\n}\n%s = math.Float32frombits(binary.LittleEndian.Uint32(data[:4]))\ndata = data[4:]\n", into), nil
+		case types.Float64:
+			st.Math = true
+			return fmt.Sprintf("if len(data) < 8 {\n\treturn fmt.Errorf(\"unionize: short buffer\")\n}\n%s = math.Float64frombits(binary.LittleEndian.Uint64(data[:8]))\ndata = data[8:]\n", into), nil
+		}
+		return "", fmt.Errorf("unionize: -encoding does not support field type %s", t)
+	case *types.Array:
+		elem := u.Elem()
+		idx := fmt.Sprintf("unionizeI%d", depth)
+		body, err := st.decodeField(fmt.Sprintf("%s[%s]", into, idx), elem, depth+1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("for %s := 0; %s < %d; %s++ {\n%s}\n", idx, idx, u.Len(), idx, body), nil
+	case *types.Struct:
+		if hasBinaryMarshaler(t) {
+			return fmt.Sprintf(`{
+	b, rest, err := unionizeReadLenPrefixed(data)
+	if err != nil {
+		return err
+	}
+	if err := (&%s).UnmarshalBinary(b); err != nil {
+		return err
+	}
+	data = rest
+}
+`, into), nil
+		}
+		st.Gob = true
+		return fmt.Sprintf(`{
+	b, rest, err := unionizeReadLenPrefixed(data)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&%s); err != nil {
+		return err
+	}
+	data = rest
+}
+`, into), nil
+	}
+	return "", fmt.Errorf("unionize: -encoding does not support field type %s", t)
+}
+
+// StringMarshal builds the MarshalBinary/UnmarshalBinary methods for a
+// tagged union, plus any runtime helpers they need. The wire format is a
+// one-byte variant tag (the field's position in the template struct)
+// followed by the little-endian encoding of that variant's value. pkg is
+// the union's package, used to qualify any named field types that need it
+// in the generated source. checked must be set when the union's accessors
+// were generated with -tagged=checked, since those return (T, bool) instead
+// of T.
+func StringMarshal(name string, fields []Field, pkg *types.Package, checked bool) (string, *MarshalState, error) {
+	st := &MarshalState{pkg: pkg}
+
+	var cases, ucases string
+	for i, f := range fields {
+		// Checked accessors return (T, bool); pull the value into a plain
+		// local first so encodeField has a single-value expression to walk.
+		var getStmt, getExpr string
+		if checked {
+			getExpr = "v0"
+			getStmt = fmt.Sprintf("v0, _ := u.%s()\n", f.name)
+		} else {
+			getExpr = fmt.Sprintf("u.%s()", f.name)
+		}
+
+		enc, err := st.encodeField(getExpr, f.typ, 0)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		cases += fmt.Sprintf("\tcase %d:\n%s%s", i, indent(getStmt), indent(enc))
+
+		dec, err := st.decodeField("v", f.typ, 0)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		ucases += fmt.Sprintf("\tcase %d:\n\t\tvar v %s\n%s\t\tu.%sPut(v)\n", i, types.TypeString(f.typ, qual(pkg)), indent(indent(dec)), f.name)
+	}
+
+	s := fmt.Sprintf(marshalTemplate, name, cases)
+	s += fmt.Sprintf(unmarshalTemplate, name, ucases)
+	s += wireHelpers
+
+	return s, st, nil
+}
+
+// indent prefixes every line of s with a tab, for nesting generated
+// statements inside a switch case.
+func indent(s string) string {
+	out := ""
+	for _, line := range splitLines(s) {
+		if line == "" {
+			out += "\n"
+			continue
+		}
+		out += "\t" + line + "\n"
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			lines = append(lines, s[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		lines = append(lines, s[start:])
+	}
+	return lines
+}
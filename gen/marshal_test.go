@@ -0,0 +1,79 @@
+package gen
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// TestStringMarshalCheckedAndNestedArrays exercises the two bugs that
+// shipped alongside -encoding: a checked accessor's (T, bool) return value
+// being substituted into a single-value expression, and a loop variable
+// collision on array-of-array fields. It generates a -tagged=checked union
+// with a float64 variant and a [2][3]int32 variant, then compiles and runs
+// an actual MarshalBinary/UnmarshalBinary round trip for each.
+func TestStringMarshalCheckedAndNestedArrays(t *testing.T) {
+	strct := types.NewStruct([]*types.Var{
+		types.NewVar(0, nil, "F", types.Typ[types.Float64]),
+		types.NewVar(0, nil, "M", types.NewArray(types.NewArray(types.Typ[types.Int32], 3), 2)),
+	}, nil)
+	fields := UnionFields(strct)
+	sz, align := UnionSize(strct, types.SizesFor("gc", "amd64"))
+
+	unionSrc, err := StringUnion("TU", sz, align, fields, nil, true, true)
+	marshalSrc, mst, err := StringMarshal("TU", fields, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imports := []string{"\"bytes\"", "\"encoding/binary\"", "\"fmt\"", "\"unsafe\""}
+	if mst.Math {
+		imports = append(imports, "\"math\"")
+	}
+
+	src := fmt.Sprintf(`package main
+
+import (
+%s
+)
+
+%s
+%s
+
+func roundTrip(u TU) TU {
+	b, err := u.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	var got TU
+	if err := got.UnmarshalBinary(b); err != nil {
+		panic(err)
+	}
+	return got
+}
+
+func main() {
+	var u1 TU
+	u1.FPut(3.25)
+	got1 := roundTrip(u1)
+	if v, ok := got1.F(); !ok || v != 3.25 {
+		panic(fmt.Sprintf("F round trip: got %%v %%v", v, ok))
+	}
+
+	var u2 TU
+	u2.MPut([2][3]int32{{0, 1, 2}, {10, 11, 12}})
+	got2 := roundTrip(u2)
+	if v, ok := got2.M(); !ok || v != [2][3]int32{{0, 1, 2}, {10, 11, 12}} {
+		panic(fmt.Sprintf("M round trip: got %%v %%v", v, ok))
+	}
+
+	fmt.Println("ok")
+}
+`, strings.Join(imports, "\n"), unionSrc, marshalSrc)
+
+	out := compileAndRun(t, src)
+	if strings.TrimSpace(out) != "ok" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
@@ -0,0 +1,109 @@
+package gen
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// templateStruct returns a two-variant template struct: an I1 uint32 and an
+// I2 uint16, mirroring the example/ package.
+func templateStruct() *types.Struct {
+	return types.NewStruct([]*types.Var{
+		types.NewVar(0, nil, "I1", types.Typ[types.Uint32]),
+		types.NewVar(0, nil, "I2", types.Typ[types.Uint16]),
+	}, nil)
+}
+
+func wrapUnion(unionSrc, driver string) string {
+	return fmt.Sprintf(`package main
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+%s
+
+func main() {
+%s
+}
+`, unionSrc, driver)
+}
+
+func TestStringUnionTaggedPanics(t *testing.T) {
+	strct := templateStruct()
+	fields := UnionFields(strct)
+	sz, align := UnionSize(strct, types.SizesFor("gc", "amd64"))
+
+	unionSrc, err := StringUnion("TU", sz, align, fields, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := `
+	var u TU
+	u.I1Put(0xdeadbeef)
+	if u.Kind() != TUI1 {
+		panic("wrong kind after I1Put")
+	}
+	if u.I1() != 0xdeadbeef {
+		panic("wrong value")
+	}
+	defer func() {
+		if recover() == nil {
+			panic("expected I2() to panic after I1Put")
+		}
+		fmt.Println("ok")
+	}()
+	_ = u.I2()
+`
+	out := compileAndRun(t, wrapUnion(unionSrc, driver))
+	if strings.TrimSpace(out) != "ok" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+// TestStringUnionTaggedDuplicateTagConst checks that two fields whose names
+// differ only in the case of their first letter (a normal Go naming
+// pattern, e.g. "err"/"Err") are rejected rather than silently producing a
+// duplicate tag constant declaration.
+func TestStringUnionTaggedDuplicateTagConst(t *testing.T) {
+	strct := types.NewStruct([]*types.Var{
+		types.NewVar(0, nil, "i1", types.Typ[types.Uint32]),
+		types.NewVar(0, nil, "I1", types.Typ[types.Uint16]),
+	}, nil)
+	fields := UnionFields(strct)
+	sz, align := UnionSize(strct, types.SizesFor("gc", "amd64"))
+
+	if _, err := StringUnion("TU", sz, align, fields, nil, true, false); err == nil {
+		t.Fatal("expected an error for colliding tag constant names, got nil")
+	}
+}
+
+func TestStringUnionTaggedCheckedNoPanic(t *testing.T) {
+	strct := templateStruct()
+	fields := UnionFields(strct)
+	sz, align := UnionSize(strct, types.SizesFor("gc", "amd64"))
+
+	unionSrc, err := StringUnion("TU", sz, align, fields, nil, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := `
+	var u TU
+	u.I1Put(0xdeadbeef)
+	if _, ok := u.I2(); ok {
+		panic("expected ok=false reading I2 after I1Put")
+	}
+	u.Reset()
+	if u.Kind() != TUI1 {
+		panic("Reset did not restore zero variant")
+	}
+	fmt.Println("ok")
+`
+	out := compileAndRun(t, wrapUnion(unionSrc, driver))
+	if strings.TrimSpace(out) != "ok" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
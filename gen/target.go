@@ -0,0 +1,29 @@
+package gen
+
+import "go/types"
+
+// fallbackSizes covers GOARCHes that types.SizesFor("gc", ...) might not
+// recognize on older toolchains. Values are word size / max alignment, both
+// in bytes, matching the "gc" compiler's own sizing rules.
+var fallbackSizes = map[string]*types.StdSizes{
+	"386":     {WordSize: 4, MaxAlign: 4},
+	"arm":     {WordSize: 4, MaxAlign: 4},
+	"arm64":   {WordSize: 8, MaxAlign: 8},
+	"wasm":    {WordSize: 8, MaxAlign: 8},
+	"riscv64": {WordSize: 8, MaxAlign: 8},
+	"mips64":  {WordSize: 8, MaxAlign: 8},
+}
+
+// SizesForTarget returns the types.Sizes to use when generating a union for
+// goarch, preferring the standard library's own table and falling back to
+// fallbackSizes for architectures it doesn't know about. It returns nil if
+// goarch is not recognized by either.
+func SizesForTarget(goarch string) types.Sizes {
+	if s := types.SizesFor("gc", goarch); s != nil {
+		return s
+	}
+	if s, ok := fallbackSizes[goarch]; ok {
+		return s
+	}
+	return nil
+}
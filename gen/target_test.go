@@ -0,0 +1,69 @@
+package gen
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// TestSizesForTarget checks that cross-target sizing actually differs
+// between a 64-bit and a 32-bit target, for a field whose size depends on
+// word size.
+func TestSizesForTarget(t *testing.T) {
+	strct := types.NewStruct([]*types.Var{
+		types.NewVar(0, nil, "P", types.Typ[types.Uintptr]),
+	}, nil)
+
+	amd64Sz, amd64Align := UnionSize(strct, SizesForTarget("amd64"))
+	if amd64Sz != 8 || amd64Align != 8 {
+		t.Fatalf("amd64: got size=%d align=%d, want 8/8", amd64Sz, amd64Align)
+	}
+
+	i386Sz, i386Align := UnionSize(strct, SizesForTarget("386"))
+	if i386Sz != 4 || i386Align != 4 {
+		t.Fatalf("386: got size=%d align=%d, want 4/4", i386Sz, i386Align)
+	}
+
+	if SizesForTarget("not-a-real-arch") != nil {
+		t.Fatalf("expected nil Sizes for an unrecognized goarch")
+	}
+}
+
+// TestCrossTargetGeneratedCodeBuilds generates a union sized for 386 (a
+// 32-bit target, unlike the presumably 64-bit host running this test),
+// with a //go:build constraint restricting it to that target, and checks
+// that the result actually cross-compiles for linux/386.
+func TestCrossTargetGeneratedCodeBuilds(t *testing.T) {
+	strct := types.NewStruct([]*types.Var{
+		types.NewVar(0, nil, "P", types.Typ[types.Uintptr]),
+	}, nil)
+	fields := UnionFields(strct)
+	sz, align := UnionSize(strct, SizesForTarget("386"))
+
+	unionSrc, err := StringUnion("TU", sz, align, fields, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := Header("linux", "386")
+
+	if !strings.Contains(header, "//go:build linux && 386") {
+		t.Fatalf("Header did not emit the expected build constraint:\n%s", header)
+	}
+
+	src := fmt.Sprintf(`%spackage main
+
+import "unsafe"
+
+%s
+
+func main() {
+	var u TU
+	u.PPut(1)
+	_ = u.P()
+	_ = unsafe.Sizeof(u)
+}
+`, header, unionSrc)
+
+	compileForTarget(t, src, "linux", "386")
+}
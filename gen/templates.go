@@ -0,0 +1,147 @@
+package gen
+
+// header is written verbatim at the top of every generated file.
+const header = `// Code generated by unionize. DO NOT EDIT.
+
+`
+
+// buildTagTemplate constrains a generated file to the GOOS/GOARCH it was
+// sized for, so union files generated for multiple targets can coexist in
+// one package.
+const buildTagTemplate = `//go:build %s && %s
+
+`
+
+const packageTemplate = `package %s
+
+`
+
+const importTemplate = `import (
+%s
+)
+
+`
+
+// structTemplate declares the backing buffer for a union with no tag.
+const structTemplate = `type %s struct {
+	b [%d]%s
+}
+
+`
+
+// taggedStructTemplate declares the backing buffer plus a discriminant byte
+// for a union generated with -tagged.
+const taggedStructTemplate = `type %s struct {
+	b    [%d]%s
+	_tag uint8
+}
+
+`
+
+// fieldTemplate emits the raw, unchecked accessor pair for a union field.
+const fieldTemplate = `func (u *%[1]s) %[2]s() %[3]s {
+	return *(*%[3]s)(unsafe.Pointer(&u.b[0]))
+}
+
+func (u *%[1]s) %[2]sPut(v %[3]s) {
+	*(*%[3]s)(unsafe.Pointer(&u.b[0])) = v
+}
+
+`
+
+// tagConstTemplate declares the exported tag constant for one variant of a
+// tagged union.
+const tagConstTemplate = `const %s%s = %d
+
+`
+
+// kindTemplate emits the Kind method, which reports the tag of the variant
+// currently stored in a tagged union.
+const kindTemplate = `func (u *%[1]s) Kind() uint8 {
+	return u._tag
+}
+
+`
+
+// numFieldsTemplate emits NumFields, which reports how many variants a
+// tagged union has. -encoding relies on this to validate a decoded tag.
+const numFieldsTemplate = `func (u *%[1]s) NumFields() int {
+	return %[2]d
+}
+
+`
+
+// resetTemplate zeroes out the buffer and tag of a tagged union.
+const resetTemplate = `func (u *%[1]s) Reset() {
+	u.b = [%[2]d]%[3]s{}
+	u._tag = 0
+}
+
+`
+
+// taggedFieldTemplate emits an accessor pair for a tagged union field. The
+// getter panics if the union does not currently hold this variant.
+const taggedFieldTemplate = `func (u *%[1]s) %[2]s() %[3]s {
+	if u._tag != %[4]d {
+		panic("%[1]s: %[2]s: wrong tag")
+	}
+	return *(*%[3]s)(unsafe.Pointer(&u.b[0]))
+}
+
+func (u *%[1]s) %[2]sPut(v %[3]s) {
+	u._tag = %[4]d
+	*(*%[3]s)(unsafe.Pointer(&u.b[0])) = v
+}
+
+`
+
+// marshalTemplate emits MarshalBinary for a tagged union. cases is one
+// switch case per variant, keyed on the variant's tag.
+const marshalTemplate = `func (u *%[1]s) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(u._tag)
+	switch u._tag {
+%[2]s	default:
+		return nil, fmt.Errorf("%[1]s: unknown tag %%d", u._tag)
+	}
+	return buf.Bytes(), nil
+}
+
+`
+
+// unmarshalTemplate emits UnmarshalBinary for a tagged union. cases is one
+// switch case per variant, keyed on the variant's tag.
+const unmarshalTemplate = `func (u *%[1]s) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("%[1]s: short buffer")
+	}
+	tag := data[0]
+	data = data[1:]
+	if int(tag) >= u.NumFields() {
+		return fmt.Errorf("%[1]s: unknown tag %%d", tag)
+	}
+	switch tag {
+%[2]s	}
+	u._tag = tag
+	return nil
+}
+
+`
+
+// taggedCheckedFieldTemplate is the -tagged=checked variant of
+// taggedFieldTemplate: the getter reports ok=false on a tag mismatch instead
+// of panicking.
+const taggedCheckedFieldTemplate = `func (u *%[1]s) %[2]s() (%[3]s, bool) {
+	if u._tag != %[4]d {
+		var zero %[3]s
+		return zero, false
+	}
+	return *(*%[3]s)(unsafe.Pointer(&u.b[0])), true
+}
+
+func (u *%[1]s) %[2]sPut(v %[3]s) {
+	u._tag = %[4]d
+	*(*%[3]s)(unsafe.Pointer(&u.b[0])) = v
+}
+
+`
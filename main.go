@@ -5,130 +5,23 @@ import (
 	"flag"
 	"fmt"
 	"go/format"
+	"go/token"
 	"go/types"
 	"io/ioutil"
 	"os"
-	"strings"
+	"runtime"
 
 	"golang.org/x/tools/go/packages"
-)
-
-// I believe there are no types in Go with alignment 16.
-var alignments = map[int64]string{
-	1: "uint8",
-	2: "uint16",
-	4: "uint32",
-	8: "uint64",
-}
-
-// FindUnion finds the struct that should be used as a template for
-// the union.
-func FindUnion(pkg *packages.Package, name string) *types.Struct {
-	for _, d := range pkg.TypesInfo.Defs {
-		if d != nil && d.Name() == name {
-			s, ok := d.Type().Underlying().(*types.Struct)
-			if ok {
-				return s
-			}
-		}
-	}
-
-	return nil
-}
-
-// UnionSize returns the size and alignment necessary for the underyling union
-// buffer given the template struct.
-func UnionSize(s *types.Struct, lookup types.Sizes) (int64, int64) {
-	var maxsz int64
-	var maxalign int64
-
-	for i := 0; i < s.NumFields(); i++ {
-		f := s.Field(i)
-		sz := lookup.Sizeof(f.Type())
-		align := lookup.Alignof(f.Type())
-		if sz > maxsz {
-			maxsz = sz
-		}
-		if align > maxalign {
-			maxalign = align
-		}
-	}
-
-	if maxsz%maxalign != 0 {
-		maxsz = maxsz - maxsz%maxalign + maxalign
-	}
-	return maxsz, maxalign
-}
-
-// Field represents a field of the union.
-type Field struct {
-	name string
-	typ  types.Type
-}
-
-// UnionFields returns the fields of the union given the template struct.
-func UnionFields(s *types.Struct) []Field {
-	fields := make([]Field, s.NumFields())
-	for i := 0; i < s.NumFields(); i++ {
-		f := s.Field(i)
-		fields[i] = Field{
-			name: f.Name(),
-			typ:  f.Type(),
-		}
-	}
-	return fields
-}
-
-// GetImports returns the names of any packages that are needed to access
-// the types in the union fields.
-func GetImports(fields []Field, pkg *types.Package) []string {
-	imports := make([]string, 0)
-	for _, f := range fields {
-		if t, ok := f.typ.(*types.Named); ok {
-			if pkg != t.Obj().Pkg() {
-				imports = append(imports, "\""+t.Obj().Pkg().Path()+"\"")
-			}
-		}
-	}
-	return imports
-}
 
-func qual(pkg *types.Package) types.Qualifier {
-	if pkg == nil {
-		return nil
-	}
-	return func(other *types.Package) string {
-		if pkg == other {
-			return ""
-		}
-		return other.Name()
-	}
-}
-
-// StringUnion builds the source code for the union.
-func StringUnion(name string, size, align int64, fields []Field, pkg *types.Package) string {
-	// This is a little bit of a hack in order to make the union type
-	// properly aligned. The union must be aligned to the largest member, and
-	// using a byte array will have alignment 1, so we use an array of type
-	// T, where T has the correct alignment.  The `alignments` map contains
-	// primitive types with alignments up to 8. We also have to adjust the
-	// size, since the primitive type of the buffer will be modified.
-	typ := alignments[align]
-	size /= align
-	s := fmt.Sprintf(structTemplate, name, size, typ)
-
-	for _, f := range fields {
-		s += fmt.Sprintf(fieldTemplate, name, f.name, types.TypeString(f.typ, qual(pkg)))
-	}
-
-	return s
-}
+	"github.com/zyedidia/unionize/gen"
+)
 
 func main() {
 	flag.Usage = func() {
 		fmt.Println("Usage of unionize:")
 		fmt.Println("\tunionize [flags] T [directory]")
 		fmt.Println("\tunionize [flags] T files...")
+		fmt.Println("\tunionize [flags] 'T[A,B,...]' [directory]  (generic template)")
 		fmt.Println("For more information, see:")
 		fmt.Println("\thttps://github.com/zyedidia/unionize")
 		fmt.Println("Flags:")
@@ -139,6 +32,10 @@ func main() {
 	flagPkg := flag.String("pkg", "main", "output package name")
 	flagUnion := flag.String("otype", "", "output union type name")
 	flagFile := flag.String("output", "", "output file name")
+	flagTagged := flag.String("tagged", "", "generate a tagged union (\"true\" for panicking accessors, \"checked\" for accessors that return an ok bool)")
+	flagEncoding := flag.Bool("encoding", false, "generate MarshalBinary/UnmarshalBinary methods (requires -tagged)")
+	flagGOOS := flag.String("goos", "", "target GOOS for the emitted //go:build constraint (size/alignment depends only on -goarch)")
+	flagGOARCH := flag.String("goarch", "", "target GOARCH for size/alignment calculations, instead of the host's")
 
 	flag.Parse()
 	args := flag.Args()
@@ -165,34 +62,123 @@ func main() {
 	}
 
 	pkg := pkgs[0]
-	strct := FindUnion(pkg, args[0])
-	if strct == nil {
-		fmt.Fprintf(os.Stderr, "Error: could not find struct to unionize\n")
-		os.Exit(1)
-	}
 
+	name, typeArgExprs := gen.ParseUnionArg(args[0])
+
+	var strct *types.Struct
 	var unionName string
-	if flagUnion != nil && *flagUnion != "" {
-		unionName = *flagUnion
+	if len(typeArgExprs) > 0 {
+		named := gen.FindGenericUnion(pkg.TypesInfo, name)
+		if named == nil {
+			fmt.Fprintf(os.Stderr, "Error: could not find generic struct %q to unionize\n", name)
+			os.Exit(1)
+		}
+
+		targs := make([]types.Type, len(typeArgExprs))
+		for i, expr := range typeArgExprs {
+			tv, err := evalTypeArg(pkg, named, expr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: could not resolve type argument %q: %v\n", expr, err)
+				os.Exit(1)
+			}
+			targs[i] = tv
+		}
+
+		strct, err = gen.InstantiateUnion(named, targs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if flagUnion != nil && *flagUnion != "" {
+			unionName = *flagUnion
+		} else {
+			unionName = gen.MangleName(name, targs)
+		}
 	} else {
-		unionName = args[0] + "Union"
+		strct = gen.FindUnion(pkg.TypesInfo, name)
+		if strct == nil {
+			fmt.Fprintf(os.Stderr, "Error: could not find struct to unionize\n")
+			os.Exit(1)
+		}
+
+		if flagUnion != nil && *flagUnion != "" {
+			unionName = *flagUnion
+		} else {
+			unionName = name + "Union"
+		}
 	}
 
-	sz, align := UnionSize(strct, pkg.TypesSizes)
+	sizes := pkg.TypesSizes
+	if *flagGOARCH != "" {
+		sizes = gen.SizesForTarget(*flagGOARCH)
+		if sizes == nil {
+			fmt.Fprintf(os.Stderr, "Error: unsupported -goarch %q\n", *flagGOARCH)
+			os.Exit(1)
+		}
+	}
 
-	if _, ok := alignments[align]; !ok {
+	sz, align := gen.UnionSize(strct, sizes)
+
+	if !gen.AlignmentOK(align) {
 		fmt.Printf("Warning: alignment of %d cannot be satisfied with a primitive type, using alignment of %d instead\n", align, 8)
 		align = 8
 	}
 
-	fields := UnionFields(strct)
-	imports := GetImports(fields, pkg.Types)
+	fields := gen.UnionFields(strct)
+	imports := gen.GetImports(fields, pkg.Types)
+
+	tagged := *flagTagged != ""
+	checked := *flagTagged == "checked"
+	if tagged && !checked && *flagTagged != "true" {
+		fmt.Fprintf(os.Stderr, "Error: invalid value %q for -tagged, must be \"true\" or \"checked\"\n", *flagTagged)
+		os.Exit(1)
+	}
+	if *flagEncoding && !tagged {
+		fmt.Fprintf(os.Stderr, "Error: -encoding requires -tagged\n")
+		os.Exit(1)
+	}
+
+	unionSrc, err := gen.StringUnion(unionName, sz, align, fields, pkg.Types, tagged, checked)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	stdImports := []string{"\"unsafe\""}
+	var marshalSrc string
+	if *flagEncoding {
+		var mst *gen.MarshalState
+		marshalSrc, mst, err = gen.StringMarshal(unionName, fields, pkg.Types, checked)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		stdImports = append(stdImports, "\"bytes\"", "\"encoding/binary\"", "\"fmt\"")
+		if mst.Gob {
+			stdImports = append(stdImports, "\"encoding/gob\"")
+		}
+		if mst.Math {
+			stdImports = append(stdImports, "\"math\"")
+		}
+	}
+
+	goos, goarch := *flagGOOS, *flagGOARCH
+	if goos != "" || goarch != "" {
+		if goos == "" {
+			goos = runtime.GOOS
+		}
+		if goarch == "" {
+			goarch = runtime.GOARCH
+		}
+	}
 
 	buf := &bytes.Buffer{}
-	buf.WriteString(header)
-	buf.WriteString(fmt.Sprintf(packageTemplate, *flagPkg))
-	buf.WriteString(fmt.Sprintf(importTemplate, strings.Join(imports, "\n")))
-	buf.WriteString(StringUnion(unionName, sz, align, fields, pkg.Types))
+	buf.WriteString(gen.Header(goos, goarch))
+	buf.WriteString(gen.Package(*flagPkg))
+	buf.WriteString(gen.Imports(stdImports, imports))
+	buf.WriteString(unionSrc)
+	buf.WriteString(marshalSrc)
 
 	output, err := format.Source(buf.Bytes())
 	if err != nil {
@@ -208,3 +194,27 @@ func main() {
 		fmt.Print(string(output))
 	}
 }
+
+// evalTypeArg resolves a generic type-argument expression like "sub.Foo" to
+// a types.Type. It is evaluated with go/types, which needs a position with
+// file scope to see which packages are imported under which names -
+// token.NoPos has no such scope, so a qualified identifier would never
+// resolve. The file declaring named isn't necessarily the file that imports
+// the package expr refers to, so we try that file first, then fall back to
+// every other file in pkg, keeping the first successful resolution.
+func evalTypeArg(pkg *packages.Package, named *types.Named, expr string) (types.Type, error) {
+	positions := []token.Pos{named.Obj().Pos()}
+	for _, f := range pkg.Syntax {
+		positions = append(positions, f.End())
+	}
+
+	var lastErr error
+	for _, pos := range positions {
+		tv, err := types.Eval(pkg.Fset, pkg.Types, pos, expr)
+		if err == nil {
+			return tv.Type, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
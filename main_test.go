@@ -0,0 +1,42 @@
+package main
+
+import (
+	"go/types"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/zyedidia/unionize/gen"
+)
+
+// TestEvalTypeArgCrossPackage checks that a generic type argument which is
+// a qualified identifier from another package (e.g. "sub.Foo") resolves
+// even when the file declaring the generic struct doesn't itself import
+// that package - only some other file in the same package does, which is
+// the scenario that failed when types.Eval was called with token.NoPos.
+func TestEvalTypeArgCrossPackage(t *testing.T) {
+	cfg := &packages.Config{Mode: packages.LoadTypes | packages.LoadSyntax | packages.LoadImports, Dir: "testdata/generic"}
+	pkgs, err := packages.Load(cfg, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		t.Fatal("errors loading testdata/generic")
+	}
+	pkg := pkgs[0]
+
+	named := gen.FindGenericUnion(pkg.TypesInfo, "Pair")
+	if named == nil {
+		t.Fatal("could not find generic struct Pair")
+	}
+
+	typ, err := evalTypeArg(pkg, named, "sub.Foo")
+	if err != nil {
+		t.Fatalf("could not resolve sub.Foo: %v", err)
+	}
+
+	named2, ok := typ.(*types.Named)
+	if !ok || named2.Obj().Name() != "Foo" {
+		t.Fatalf("resolved to %v, want sub.Foo", typ)
+	}
+}
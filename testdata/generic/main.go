@@ -0,0 +1,11 @@
+package main
+
+// Pair is a generic template struct. It deliberately doesn't reference sub
+// itself, to check that a generic type argument from another package can
+// still be resolved as long as some other file in the package imports it.
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+func main() {}
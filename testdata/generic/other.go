@@ -0,0 +1,5 @@
+package main
+
+import "generictestfixture/sub"
+
+var _ = sub.Foo{}
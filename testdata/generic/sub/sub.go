@@ -0,0 +1,7 @@
+package sub
+
+// Foo is a struct in another package, used to check that unionize can
+// resolve a generic type argument that's a qualified identifier.
+type Foo struct {
+	X int32
+}